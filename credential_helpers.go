@@ -0,0 +1,219 @@
+package libmachete
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+// Helper resolves and stores secrets with an external process, following the
+// docker-credential-helpers protocol: verbs are passed as the single argument,
+// and the payload is exchanged as JSON on stdin/stdout.
+type Helper interface {
+	// Get returns the username and secret stored for serverURL.
+	Get(serverURL string) (username, secret string, err error)
+
+	// Store saves the username and secret under serverURL.
+	Store(serverURL, username, secret string) error
+
+	// Erase removes any credential stored for serverURL.
+	Erase(serverURL string) error
+
+	// List returns the server URLs known to the helper, mapped to their usernames.
+	List() (map[string]string, error)
+}
+
+// HelperResolver locates the Helper implementation for a named helper.
+type HelperResolver interface {
+	Resolve(name string) (Helper, error)
+}
+
+var (
+	helpers     = map[string]Helper{}
+	helpersLock sync.Mutex
+)
+
+// RegisterCredentialHelper registers a Helper under name, so that credentials
+// referencing {"helper": name, ...} resolve to it instead of being looked up
+// as a docker-credential-<name> binary on PATH.
+func RegisterCredentialHelper(name string, h Helper) {
+	helpersLock.Lock()
+	defer helpersLock.Unlock()
+
+	helpers[name] = h
+}
+
+type pathHelperResolver struct{}
+
+// DefaultHelperResolver resolves helpers registered with RegisterCredentialHelper,
+// falling back to an executable named docker-credential-<name> on PATH.
+var DefaultHelperResolver HelperResolver = pathHelperResolver{}
+
+func (pathHelperResolver) Resolve(name string) (Helper, error) {
+	helpersLock.Lock()
+	h, has := helpers[name]
+	helpersLock.Unlock()
+	if has {
+		return h, nil
+	}
+
+	binary := "docker-credential-" + name
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("no credential helper registered or found on PATH for %v: %v", name, err)
+	}
+	return &execHelper{binary: binary}, nil
+}
+
+// execHelper drives a docker-credential-<name> binary found on PATH.
+type execHelper struct {
+	binary string
+}
+
+type execHelperPayload struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func (h *execHelper) Get(serverURL string) (string, string, error) {
+	cmd := exec.Command(h.binary, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", "", fmt.Errorf("credential helper %v get failed: %v", h.binary, err)
+	}
+
+	resp := execHelperPayload{}
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return "", "", fmt.Errorf("credential helper %v returned invalid response: %v", h.binary, err)
+	}
+	return resp.Username, resp.Secret, nil
+}
+
+func (h *execHelper) Store(serverURL, username, secret string) error {
+	in, err := json.Marshal(execHelperPayload{ServerURL: serverURL, Username: username, Secret: secret})
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(h.binary, "store")
+	cmd.Stdin = bytes.NewReader(in)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("credential helper %v store failed: %v: %s", h.binary, err, out)
+	}
+	return nil
+}
+
+func (h *execHelper) Erase(serverURL string) error {
+	cmd := exec.Command(h.binary, "erase")
+	cmd.Stdin = strings.NewReader(serverURL)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("credential helper %v erase failed: %v: %s", h.binary, err, out)
+	}
+	return nil
+}
+
+func (h *execHelper) List() (map[string]string, error) {
+	cmd := exec.Command(h.binary, "list")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("credential helper %v list failed: %v", h.binary, err)
+	}
+
+	list := map[string]string{}
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, fmt.Errorf("credential helper %v returned invalid list: %v", h.binary, err)
+	}
+	return list, nil
+}
+
+// helperReference is the thin pointer a credential can hold in place of its
+// secret fields. Concrete provisioner credentials that embed api.CredentialBase
+// pick these fields up for free, so they round-trip through Save/Get unchanged.
+type helperReference struct {
+	Helper        string `json:"helper,omitempty"`
+	Key           string `json:"key,omitempty"`
+	StoreInHelper bool   `json:"store_in_helper,omitempty"`
+}
+
+// HelperSecretCarrier is implemented by provisioner credentials whose secret
+// can be resolved from, or stored into, an external credential helper.
+// resolveHelper/storeInHelper rely on it instead of guessing at field names
+// like Username/Secret: real provisioner credentials name their secrets
+// whatever makes sense for them (AWS AccessKeyID/SecretAccessKey, Azure
+// ClientSecret, a GCE service-account blob, ...), and a credential that
+// references a helper without implementing this is a configuration error,
+// not something to silently ignore.
+type HelperSecretCarrier interface {
+	api.Credential
+
+	// ApplyHelperSecret merges a secret resolved from the credential helper
+	// onto the receiver.
+	ApplyHelperSecret(username, secret string)
+
+	// HelperSecret returns the username/secret that should be written to the
+	// referenced credential helper. It is called just before the fields it
+	// returns are blanked out of the receiver.
+	HelperSecret() (username, secret string)
+}
+
+// resolveHelper checks whether detail (already decrypted and unmarshaled by
+// Get) is a helper reference and, if so, fetches the secret and merges it
+// onto detail. It works off detail itself, not the raw store bytes, so it
+// sees the same plaintext fields whether or not the manager is encrypted.
+func (cm *credentials) resolveHelper(key string, detail api.Credential) error {
+	raw, err := cm.Marshal(nil, detail)
+	if err != nil {
+		return err
+	}
+
+	ref := new(helperReference)
+	if err := cm.Unmarshal(nil, raw, ref); err != nil || ref.Helper == "" {
+		return nil
+	}
+
+	carrier, ok := detail.(HelperSecretCarrier)
+	if !ok {
+		return fmt.Errorf("credential %v references helper %q but %T does not implement HelperSecretCarrier", key, ref.Helper, detail)
+	}
+
+	helper, err := DefaultHelperResolver.Resolve(ref.Helper)
+	if err != nil {
+		return err
+	}
+
+	username, secret, err := helper.Get(ref.Key)
+	if err != nil {
+		return err
+	}
+
+	carrier.ApplyHelperSecret(username, secret)
+	return nil
+}
+
+// storeInHelper writes detail's secret fields to the referenced helper and
+// blanks them out of detail, so only the reference is left to persist.
+func (cm *credentials) storeInHelper(ref *helperReference, detail api.Credential) error {
+	carrier, ok := detail.(HelperSecretCarrier)
+	if !ok {
+		return fmt.Errorf("credential references helper %q but %T does not implement HelperSecretCarrier", ref.Helper, detail)
+	}
+
+	helper, err := DefaultHelperResolver.Resolve(ref.Helper)
+	if err != nil {
+		return err
+	}
+
+	username, secret := carrier.HelperSecret()
+	if err := helper.Store(ref.Key, username, secret); err != nil {
+		return err
+	}
+
+	carrier.ApplyHelperSecret("", "")
+	return nil
+}
@@ -0,0 +1,241 @@
+package libmachete
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+type credWithHelperFields struct {
+	Provisioner   string `json:"provisioner"`
+	Helper        string `json:"helper,omitempty"`
+	Key           string `json:"key,omitempty"`
+	StoreInHelper bool   `json:"store_in_helper,omitempty"`
+	Username      string `json:"Username,omitempty"`
+	Secret        string `json:"Secret,omitempty"`
+}
+
+func (c *credWithHelperFields) ProvisionerName() string { return c.Provisioner }
+
+func (c *credWithHelperFields) ApplyHelperSecret(username, secret string) {
+	c.Username, c.Secret = username, secret
+}
+
+func (c *credWithHelperFields) HelperSecret() (string, string) {
+	return c.Username, c.Secret
+}
+
+// awsLikeCredential models a realistic provisioner shape whose secret fields
+// don't happen to be named Username/Secret, to prove resolveHelper/
+// storeInHelper no longer depend on guessing at field names.
+type awsLikeCredential struct {
+	Provisioner     string `json:"provisioner"`
+	Helper          string `json:"helper,omitempty"`
+	Key             string `json:"key,omitempty"`
+	StoreInHelper   bool   `json:"store_in_helper,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+}
+
+func (c *awsLikeCredential) ProvisionerName() string { return c.Provisioner }
+
+func (c *awsLikeCredential) ApplyHelperSecret(username, secret string) {
+	c.AccessKeyID, c.SecretAccessKey = username, secret
+}
+
+func (c *awsLikeCredential) HelperSecret() (string, string) {
+	return c.AccessKeyID, c.SecretAccessKey
+}
+
+// credWithoutHelperSupport has the helper and key reference fields of
+// credWithHelperFields but deliberately does not implement HelperSecretCarrier.
+type credWithoutHelperSupport struct {
+	Provisioner string `json:"provisioner"`
+	Helper      string `json:"helper,omitempty"`
+	Key         string `json:"key,omitempty"`
+}
+
+func (c *credWithoutHelperSupport) ProvisionerName() string { return c.Provisioner }
+
+type recordingHelper struct {
+	stored map[string][2]string // serverURL -> [username, secret]
+}
+
+func newRecordingHelper() *recordingHelper {
+	return &recordingHelper{stored: map[string][2]string{}}
+}
+
+func (h *recordingHelper) Get(serverURL string) (string, string, error) {
+	v := h.stored[serverURL]
+	return v[0], v[1], nil
+}
+
+func (h *recordingHelper) Store(serverURL, username, secret string) error {
+	h.stored[serverURL] = [2]string{username, secret}
+	return nil
+}
+
+func (h *recordingHelper) Erase(serverURL string) error {
+	delete(h.stored, serverURL)
+	return nil
+}
+
+func (h *recordingHelper) List() (map[string]string, error) {
+	out := map[string]string{}
+	for k, v := range h.stored {
+		out[k] = v[0]
+	}
+	return out, nil
+}
+
+func TestCreateCredentialStoresSecretInHelper(t *testing.T) {
+	RegisterCredentialer("helper-create", func() api.Credential { return &credWithHelperFields{} })
+	helper := newRecordingHelper()
+	RegisterCredentialHelper("recording", helper)
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	input := `{"provisioner":"helper-create","helper":"recording","key":"server-1","store_in_helper":true,"Username":"alice","Secret":"s3cr3t"}`
+	if cerr := creds.CreateCredential("helper-create", "key-1", bytes.NewBufferString(input), nil); cerr != nil {
+		t.Fatal(cerr)
+	}
+
+	if helper.stored["server-1"][1] != "s3cr3t" {
+		t.Fatalf("expected secret stored in helper, got %v", helper.stored["server-1"])
+	}
+
+	saved := new(credWithHelperFields)
+	if err := store.GetCredentials("key-1", saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Secret != "" {
+		t.Fatalf("expected secret blanked out of the persisted record, got %v", saved.Secret)
+	}
+}
+
+func TestGetResolvesCredentialFromHelper(t *testing.T) {
+	RegisterCredentialer("helper-get", func() api.Credential { return &credWithHelperFields{} })
+	helper := newRecordingHelper()
+	helper.stored["server-2"] = [2]string{"bob", "t0ken"}
+	RegisterCredentialHelper("recording-get", helper)
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	ref := &credWithHelperFields{Provisioner: "helper-get", Helper: "recording-get", Key: "server-2"}
+	if err := creds.Save("key-2", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := creds.Get("key-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*credWithHelperFields).Secret != "t0ken" {
+		t.Fatalf("expected secret resolved from helper, got %v", got.(*credWithHelperFields).Secret)
+	}
+}
+
+// TestGetResolvesCredentialFromHelperWithRealisticFieldNames guards against
+// resolveHelper only working by accident when a credential's secret fields
+// happen to be named Username/Secret: AWS-shaped field names must merge too.
+func TestGetResolvesCredentialFromHelperWithRealisticFieldNames(t *testing.T) {
+	RegisterCredentialer("helper-aws", func() api.Credential { return &awsLikeCredential{} })
+	helper := newRecordingHelper()
+	helper.stored["server-3"] = [2]string{"AKIAEXAMPLE", "s3cr3t-key"}
+	RegisterCredentialHelper("recording-aws", helper)
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	ref := &awsLikeCredential{Provisioner: "helper-aws", Helper: "recording-aws", Key: "server-3"}
+	if err := creds.Save("key-3", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := creds.Get("key-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := got.(*awsLikeCredential)
+	if resolved.AccessKeyID != "AKIAEXAMPLE" || resolved.SecretAccessKey != "s3cr3t-key" {
+		t.Fatalf("expected AWS-shaped fields to be merged from the helper, got %+v", resolved)
+	}
+}
+
+// TestGetErrorsWhenCredentialDoesNotImplementHelperSecretCarrier guards
+// against resolveHelper silently no-opping (leaving secret fields blank with
+// no error) when a credential references a helper but can't receive the
+// resolved secret.
+func TestGetErrorsWhenCredentialDoesNotImplementHelperSecretCarrier(t *testing.T) {
+	RegisterCredentialer("helper-unsupported", func() api.Credential { return &credWithoutHelperSupport{} })
+	RegisterCredentialHelper("recording-unsupported", newRecordingHelper())
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	ref := &credWithoutHelperSupport{Provisioner: "helper-unsupported", Helper: "recording-unsupported", Key: "server-4"}
+	if err := creds.Save("key-4", ref); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := creds.Get("key-4"); err == nil {
+		t.Fatal("expected Get to error when the credential doesn't implement HelperSecretCarrier, got nil")
+	}
+}
+
+// fakeHelperScript is a minimal docker-credential-helpers protocol
+// implementation, good enough to exercise execHelper's stdin/stdout framing
+// without shelling out to a real keychain.
+const fakeHelperScript = `#!/bin/sh
+case "$1" in
+  store) cat > "$HELPER_STORE_FILE" ;;
+  get)
+    read -r _
+    if [ -s "$HELPER_STORE_FILE" ]; then cat "$HELPER_STORE_FILE"; else echo '{}'; fi
+    ;;
+  erase) rm -f "$HELPER_STORE_FILE" ;;
+  list) echo '{}' ;;
+esac
+`
+
+func newFakeHelperBinary(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "docker-credential-fake")
+	if err := ioutil.WriteFile(script, []byte(fakeHelperScript), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	storeFile := filepath.Join(dir, "store.json")
+	os.Setenv("HELPER_STORE_FILE", storeFile)
+	t.Cleanup(func() { os.Unsetenv("HELPER_STORE_FILE") })
+
+	return script
+}
+
+func TestExecHelperStoreAndGetRoundTrip(t *testing.T) {
+	h := &execHelper{binary: newFakeHelperBinary(t)}
+
+	if err := h.Store("https://example.com", "alice", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+
+	username, secret, err := h.Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username != "alice" || secret != "s3cr3t" {
+		t.Fatalf("expected alice/s3cr3t, got %v/%v", username, secret)
+	}
+
+	if err := h.Erase("https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+}
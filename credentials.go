@@ -1,6 +1,7 @@
 package libmachete
 
 import (
+	"context"
 	"fmt"
 	"github.com/docker/libmachete/provisioners/api"
 	"github.com/docker/libmachete/storage"
@@ -38,6 +39,16 @@ type Credentials interface {
 	// ListIds
 	ListIds() ([]string, error)
 
+	// ListByProvisioner returns the ids of every credential belonging to
+	// provisionerName. It requires a backing store that maintains a
+	// provisioner index (e.g. storage/bolt.Store).
+	ListByProvisioner(provisionerName string) ([]string, error)
+
+	// GetAllMetadata streams the CredentialBase portion of every credential
+	// belonging to provisionerName, without materializing full secrets. It
+	// requires the same indexed backing store as ListByProvisioner.
+	GetAllMetadata(ctx context.Context, provisionerName string) (<-chan api.CredentialBase, <-chan error)
+
 	// Saves the credential identified by key
 	Save(key string, cred api.Credential) error
 
@@ -55,10 +66,25 @@ type Credentials interface {
 
 	// UpdateCredential updates an existing credential
 	UpdateCredential(key string, input io.Reader, codec *codec) *CredentialError
+
+	// Rewrap re-encrypts every stored credential sealed under the current
+	// provider under newProvider; records under other key ids are skipped. It
+	// is only valid on a manager created with NewEncryptedCredentials or
+	// NewEncryptedCredentialsWithPreviousKey.
+	Rewrap(ctx context.Context, newProvider KeyProvider) error
+
+	// UseProfile resolves name through the configured Profiles manager and
+	// returns the credential it points at. Pass "" to fall back to the
+	// MACHETE_PROFILE env var. It is only valid on a manager created with
+	// NewCredentialsWithProfiles.
+	UseProfile(name string) (api.Credential, error)
 }
 
 type credentials struct {
-	store storage.Credentials
+	store        storage.Credentials
+	keys         KeyProvider
+	previousKeys KeyProvider
+	profiles     Profiles
 }
 
 // NewCredentials creates an instance of the manager given the backing store.
@@ -66,6 +92,13 @@ func NewCredentials(store storage.Credentials) Credentials {
 	return &credentials{store: store}
 }
 
+// NewCredentialsWithProfiles creates a manager whose UseProfile calls resolve
+// against profiles, so CLI entry points can pick which credential a --profile
+// flag (or the MACHETE_PROFILE env var) loads for a provisioner call.
+func NewCredentialsWithProfiles(store storage.Credentials, profiles Profiles) Credentials {
+	return &credentials{store: store, profiles: profiles}
+}
+
 func ensureValidCredentialContentType(ct *codec) *codec {
 	if ct != nil {
 		return ct
@@ -106,6 +139,9 @@ func (cm *credentials) ListIds() ([]string, error) {
 }
 
 func (cm *credentials) Save(key string, cred api.Credential) error {
+	if cm.keys != nil {
+		return cm.saveEncrypted(key, cred)
+	}
 	return cm.store.Save(storage.CredentialsID(key), cred)
 }
 
@@ -123,13 +159,56 @@ func (cm *credentials) Get(key string) (api.Credential, error) {
 		return nil, err
 	}
 
-	err = cm.store.GetCredentials(storage.CredentialsID(key), detail)
-	if err != nil {
+	if cm.keys != nil {
+		env := new(envelope)
+		if err := cm.store.GetCredentials(storage.CredentialsID(key), env); err != nil {
+			return nil, err
+		}
+
+		plaintext, err := cm.openEnvelope(key, env)
+		if err != nil {
+			return nil, err
+		}
+		if err := cm.Unmarshal(nil, plaintext, detail); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := cm.store.GetCredentials(storage.CredentialsID(key), detail); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cm.resolveHelper(key, detail); err != nil {
 		return nil, err
 	}
+
+	if refreshable, ok := detail.(RefreshableCredential); ok && refreshable.NeedsRefresh() {
+		if err := refreshable.Refresh(context.Background()); err != nil {
+			return nil, err
+		}
+		if err := cm.Save(key, detail); err != nil {
+			return nil, err
+		}
+	}
 	return detail, nil
 }
 
+// UseProfile resolves name through the configured Profiles manager and
+// returns the credential it points at. CLI entry points should pass the
+// value of their --profile flag straight through: an empty string falls
+// back to SwitchProfile's MACHETE_PROFILE handling.
+func (cm *credentials) UseProfile(name string) (api.Credential, error) {
+	if cm.profiles == nil {
+		return nil, fmt.Errorf("no profiles configured")
+	}
+
+	profile, err := cm.profiles.SwitchProfile(name)
+	if err != nil {
+		return nil, err
+	}
+	return cm.Get(profile.CredentialKey)
+}
+
 func (cm *credentials) Delete(key string) error {
 	return cm.store.Delete(storage.CredentialsID(key))
 }
@@ -173,6 +252,15 @@ func (c *credentials) CreateCredential(provisioner, key string, input io.Reader,
 	if err = c.Unmarshal(codec, buff, cr); err != nil {
 		return &CredentialError{Message: err.Error()}
 	}
+
+	ref := new(helperReference)
+	_ = c.Unmarshal(codec, buff, ref)
+	if ref.Helper != "" && ref.StoreInHelper {
+		if err := c.storeInHelper(ref, cr); err != nil {
+			return &CredentialError{Message: err.Error()}
+		}
+	}
+
 	if err = c.Save(key, cr); err != nil {
 		return &CredentialError{Message: err.Error()}
 	}
@@ -204,6 +292,14 @@ func (c *credentials) UpdateCredential(key string, input io.Reader, codec *codec
 		return &CredentialError{Message: err.Error()}
 	}
 
+	ref := new(helperReference)
+	_ = c.Unmarshal(codec, buff, ref)
+	if ref.Helper != "" && ref.StoreInHelper {
+		if err := c.storeInHelper(ref, detail); err != nil {
+			return &CredentialError{Message: err.Error()}
+		}
+	}
+
 	if err = c.Save(key, detail); err != nil {
 		return &CredentialError{Message: err.Error()}
 	}
@@ -0,0 +1,310 @@
+package libmachete
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/docker/libmachete/provisioners/api"
+	"github.com/docker/libmachete/storage"
+)
+
+// KeyProvider wraps and unwraps the per-record data keys used for envelope
+// encryption of stored credentials. Encrypt/Decrypt operate on a data
+// encryption key (DEK), never on the credential plaintext itself.
+type KeyProvider interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+	Decrypt(ciphertext []byte) ([]byte, error)
+
+	// KeyID identifies the master key currently in use, so stored envelopes
+	// can be matched against the provider that wrapped them.
+	KeyID() string
+}
+
+// envelope is the blob format persisted in place of the credential: a random
+// per-record data key (DEK), wrapped by the KeyProvider, plus the credential
+// plaintext encrypted under that DEK with AES-GCM.
+type envelope struct {
+	Provisioner string `json:"provisioner"`
+	KeyID       string `json:"key_id"`
+	WrappedDEK  []byte `json:"wrapped_dek"`
+	Nonce       []byte `json:"nonce"`
+	Ciphertext  []byte `json:"ciphertext"`
+}
+
+// ProvisionerName lets envelope stand in for an api.Credential when handed to
+// storage.Credentials.Save, so backends that index on provisioner (e.g.
+// storage/bolt) keep working on encrypted records.
+func (e *envelope) ProvisionerName() string {
+	return e.Provisioner
+}
+
+func sealEnvelope(provider KeyProvider, provisionerName string, plaintext []byte) (*envelope, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := provider.Encrypt(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	return &envelope{
+		Provisioner: provisionerName,
+		KeyID:       provider.KeyID(),
+		WrappedDEK:  wrapped,
+		Nonce:       nonce,
+		Ciphertext:  gcm.Seal(nil, nonce, plaintext, nil),
+	}, nil
+}
+
+func (e *envelope) open(provider KeyProvider) ([]byte, error) {
+	dek, err := provider.Decrypt(e.WrappedDEK)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, e.Nonce, e.Ciphertext, nil)
+}
+
+// LocalKeyProvider is a KeyProvider backed by a single AES-256 master key,
+// read once from a file (or, if path is empty, from the MACHETE_MASTER_KEY
+// env var) and held in memory for the life of the process.
+type LocalKeyProvider struct {
+	keyID string
+	key   []byte
+}
+
+// NewLocalKeyProvider reads a 32-byte master key from path, or from the
+// MACHETE_MASTER_KEY env var when path is empty, and returns a KeyProvider
+// that wraps data keys with it using AES-GCM.
+func NewLocalKeyProvider(keyID, path string) (*LocalKeyProvider, error) {
+	var key []byte
+	if path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key = data
+	} else {
+		key = []byte(os.Getenv("MACHETE_MASTER_KEY"))
+	}
+
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %v", len(key))
+	}
+	return &LocalKeyProvider{keyID: keyID, key: key}, nil
+}
+
+func (p *LocalKeyProvider) KeyID() string { return p.keyID }
+
+func (p *LocalKeyProvider) Encrypt(plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(p.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return append(nonce, gcm.Seal(nil, nonce, plaintext, nil)...), nil
+}
+
+func (p *LocalKeyProvider) Decrypt(ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(p.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	size := gcm.NonceSize()
+	if len(ciphertext) < size {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return gcm.Open(nil, ciphertext[:size], ciphertext[size:], nil)
+}
+
+// ExternalKMS is a KeyProvider that delegates wrap/unwrap operations to an
+// external process over stdio, so AWS KMS, GCP KMS, or Vault transit can be
+// plugged in without pulling their SDKs into this module. The process is
+// invoked as `<command> encrypt|decrypt`, reads the input on stdin and writes
+// the result to stdout.
+type ExternalKMS struct {
+	command string
+	keyID   string
+}
+
+// NewExternalKMS returns a KeyProvider that shells out to command for every
+// Encrypt/Decrypt call, reporting keyID as its KeyID().
+func NewExternalKMS(command, keyID string) *ExternalKMS {
+	return &ExternalKMS{command: command, keyID: keyID}
+}
+
+func (k *ExternalKMS) KeyID() string { return k.keyID }
+
+func (k *ExternalKMS) call(verb string, input []byte) ([]byte, error) {
+	cmd := exec.Command(k.command, verb)
+	cmd.Stdin = bytes.NewReader(input)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v %v: %v", k.command, verb, err)
+	}
+	return out.Bytes(), nil
+}
+
+func (k *ExternalKMS) Encrypt(plaintext []byte) ([]byte, error) {
+	return k.call("encrypt", plaintext)
+}
+
+func (k *ExternalKMS) Decrypt(ciphertext []byte) ([]byte, error) {
+	return k.call("decrypt", ciphertext)
+}
+
+// NewEncryptedCredentials creates a Credentials manager that envelope-encrypts
+// every credential with provider before handing it to store, and decrypts it
+// again on the way out.
+func NewEncryptedCredentials(store storage.Credentials, provider KeyProvider) Credentials {
+	return &credentials{store: store, keys: provider}
+}
+
+// NewEncryptedCredentialsWithPreviousKey is like NewEncryptedCredentials, but
+// also accepts the provider that wrapped records before the most recent key
+// rotation. Get transparently re-wraps any record it finds still sealed under
+// previous the first time it's read, instead of requiring every record to
+// wait for a batch Rewrap to reach it.
+func NewEncryptedCredentialsWithPreviousKey(store storage.Credentials, current, previous KeyProvider) Credentials {
+	return &credentials{store: store, keys: current, previousKeys: previous}
+}
+
+// openEnvelope decrypts env under the provider that sealed it. If env was
+// sealed under cm.keys, that's a plain open. If it was sealed under
+// cm.previousKeys (the read-time half of key rotation, complementing the
+// batch Rewrap), it's opened under that provider and then transparently
+// re-sealed under cm.keys so the next read doesn't need previousKeys at all.
+// A record sealed under any other key id is a hard error: there is no
+// provider left that can open it.
+func (cm *credentials) openEnvelope(key string, env *envelope) ([]byte, error) {
+	if env.KeyID == cm.keys.KeyID() {
+		return env.open(cm.keys)
+	}
+
+	if cm.previousKeys == nil || cm.previousKeys.KeyID() != env.KeyID {
+		return nil, fmt.Errorf("credential %v is sealed under unknown key id %v (current key id %v); register the previous key provider or run Rewrap", key, env.KeyID, cm.keys.KeyID())
+	}
+
+	plaintext, err := env.open(cm.previousKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	resealed, err := sealEnvelope(cm.keys, env.Provisioner, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if err := cm.store.Save(storage.CredentialsID(key), resealed); err != nil {
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+// saveEncrypted marshals cred, seals it in an envelope under cm.keys, and
+// saves the envelope in place of the plaintext credential.
+func (cm *credentials) saveEncrypted(key string, cred api.Credential) error {
+	plaintext, err := cm.Marshal(nil, cred)
+	if err != nil {
+		return err
+	}
+
+	env, err := sealEnvelope(cm.keys, cred.ProvisionerName(), plaintext)
+	if err != nil {
+		return err
+	}
+	return cm.store.Save(storage.CredentialsID(key), env)
+}
+
+// Rewrap re-encrypts stored credentials under newProvider: it decrypts each
+// record sealed under the manager's current provider and re-saves it sealed
+// under the new one, in a single pass. Records sealed under any other key id
+// are left as they are. Use it to rotate the master key.
+func (cm *credentials) Rewrap(ctx context.Context, newProvider KeyProvider) error {
+	if cm.keys == nil {
+		return fmt.Errorf("credentials manager is not encrypted")
+	}
+
+	ids, err := cm.store.List()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		env := new(envelope)
+		if err := cm.store.GetCredentials(id, env); err != nil {
+			return err
+		}
+		if env.KeyID != cm.keys.KeyID() {
+			continue
+		}
+
+		plaintext, err := env.open(cm.keys)
+		if err != nil {
+			return err
+		}
+
+		resealed, err := sealEnvelope(newProvider, env.Provisioner, plaintext)
+		if err != nil {
+			return err
+		}
+		if err := cm.store.Save(id, resealed); err != nil {
+			return err
+		}
+	}
+
+	cm.keys = newProvider
+	return nil
+}
@@ -0,0 +1,235 @@
+package libmachete
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/docker/libmachete/provisioners/api"
+	"github.com/docker/libmachete/storage"
+)
+
+type memStore struct {
+	data map[storage.CredentialsID][]byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: map[storage.CredentialsID][]byte{}}
+}
+
+func (s *memStore) List() ([]storage.CredentialsID, error) {
+	ids := make([]storage.CredentialsID, 0, len(s.data))
+	for id := range s.data {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *memStore) Save(id storage.CredentialsID, cred api.Credential) error {
+	blob, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	s.data[id] = blob
+	return nil
+}
+
+func (s *memStore) GetCredentials(id storage.CredentialsID, cred interface{}) error {
+	blob, has := s.data[id]
+	if !has {
+		return fmt.Errorf("not found: %v", id)
+	}
+	return json.Unmarshal(blob, cred)
+}
+
+func (s *memStore) Delete(id storage.CredentialsID) error {
+	delete(s.data, id)
+	return nil
+}
+
+func testKeyProvider(keyID string) *LocalKeyProvider {
+	return &LocalKeyProvider{keyID: keyID, key: bytes.Repeat([]byte{1}, 32)}
+}
+
+type testCredential struct {
+	Provisioner string `json:"provisioner"`
+	Secret      string `json:"secret"`
+}
+
+func (c *testCredential) ProvisionerName() string { return c.Provisioner }
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	provider := testKeyProvider("k1")
+
+	env, err := sealEnvelope(provider, "test", []byte("super-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k1" {
+		t.Fatalf("expected key id k1, got %v", env.KeyID)
+	}
+
+	plaintext, err := env.open(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "super-secret" {
+		t.Fatalf("expected round-tripped plaintext, got %v", string(plaintext))
+	}
+}
+
+func TestEncryptedSaveGetRoundTrip(t *testing.T) {
+	RegisterCredentialer("test", func() api.Credential { return &testCredential{} })
+
+	store := newMemStore()
+	creds := NewEncryptedCredentials(store, testKeyProvider("k1"))
+
+	if err := creds.Save("key-1", &testCredential{Provisioner: "test", Secret: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := creds.Get("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*testCredential).Secret != "hunter2" {
+		t.Fatalf("expected decrypted secret, got %v", got.(*testCredential).Secret)
+	}
+}
+
+func TestRewrapRotatesKey(t *testing.T) {
+	RegisterCredentialer("test", func() api.Credential { return &testCredential{} })
+
+	store := newMemStore()
+	creds := NewEncryptedCredentials(store, testKeyProvider("k1"))
+	if err := creds.Save("key-1", &testCredential{Provisioner: "test", Secret: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := creds.Rewrap(context.Background(), testKeyProvider("k2")); err != nil {
+		t.Fatal(err)
+	}
+
+	env := new(envelope)
+	if err := store.GetCredentials("key-1", env); err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k2" {
+		t.Fatalf("expected rewrapped key id k2, got %v", env.KeyID)
+	}
+
+	got, err := creds.Get("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*testCredential).Secret != "hunter2" {
+		t.Fatalf("expected decrypted secret after rewrap, got %v", got.(*testCredential).Secret)
+	}
+}
+
+// TestGetRewrapsRecordSealedUnderPreviousKey guards against Get blindly
+// calling env.open(cm.keys): a record still sealed under the key that was
+// active before the most recent rotation must be opened under previousKeys
+// and transparently re-sealed under the new one, without waiting for a batch
+// Rewrap to reach it.
+func TestGetRewrapsRecordSealedUnderPreviousKey(t *testing.T) {
+	RegisterCredentialer("test", func() api.Credential { return &testCredential{} })
+
+	store := newMemStore()
+	oldKey := testKeyProvider("k1")
+	creds := NewEncryptedCredentials(store, oldKey)
+	if err := creds.Save("key-1", &testCredential{Provisioner: "test", Secret: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a rotation that moved cm.keys forward without having rewrapped
+	// this particular record yet (e.g. Rewrap hasn't reached it, or a batch
+	// Rewrap was interrupted).
+	rotated := NewEncryptedCredentialsWithPreviousKey(store, testKeyProvider("k2"), oldKey)
+
+	got, err := rotated.Get("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*testCredential).Secret != "hunter2" {
+		t.Fatalf("expected decrypted secret via the previous key, got %v", got.(*testCredential).Secret)
+	}
+
+	env := new(envelope)
+	if err := store.GetCredentials("key-1", env); err != nil {
+		t.Fatal(err)
+	}
+	if env.KeyID != "k2" {
+		t.Fatalf("expected Get to have re-sealed the record under the new key id, got %v", env.KeyID)
+	}
+}
+
+// TestGetErrorsOnRecordSealedUnderUnknownKey guards against Get silently
+// returning garbage (or a confusing raw crypto error) when a record's key id
+// matches neither the current nor the previous provider.
+func TestGetErrorsOnRecordSealedUnderUnknownKey(t *testing.T) {
+	RegisterCredentialer("test", func() api.Credential { return &testCredential{} })
+
+	store := newMemStore()
+	creds := NewEncryptedCredentials(store, testKeyProvider("k0"))
+	if err := creds.Save("key-1", &testCredential{Provisioner: "test", Secret: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// cm.keys is now k2, and no previous key provider was registered that
+	// knows about k0.
+	orphaned := NewEncryptedCredentials(store, testKeyProvider("k2"))
+
+	if _, err := orphaned.Get("key-1"); err == nil {
+		t.Fatal("expected Get to error on a record sealed under an unknown key id, got nil")
+	}
+}
+
+type helperCredential struct {
+	Provisioner   string `json:"provisioner"`
+	Helper        string `json:"helper,omitempty"`
+	Key           string `json:"key,omitempty"`
+	StoreInHelper bool   `json:"store_in_helper,omitempty"`
+	Secret        string `json:"secret,omitempty"`
+}
+
+func (c *helperCredential) ProvisionerName() string { return c.Provisioner }
+
+func (c *helperCredential) ApplyHelperSecret(username, secret string) { c.Secret = secret }
+
+func (c *helperCredential) HelperSecret() (string, string) { return "", c.Secret }
+
+type fakeHelper struct {
+	secret string
+}
+
+func (f *fakeHelper) Get(serverURL string) (string, string, error) { return "", f.secret, nil }
+func (f *fakeHelper) Store(serverURL, username, secret string) error { return nil }
+func (f *fakeHelper) Erase(serverURL string) error { return nil }
+func (f *fakeHelper) List() (map[string]string, error) { return nil, nil }
+
+// TestResolveHelperAfterDecryption guards against resolveHelper looking at
+// raw (still-encrypted) store bytes: with encryption on, it must resolve the
+// helper reference from the decrypted detail, not silently no-op.
+func TestResolveHelperAfterDecryption(t *testing.T) {
+	RegisterCredentialer("helper-test", func() api.Credential { return &helperCredential{} })
+	RegisterCredentialHelper("fake", &fakeHelper{secret: "from-helper"})
+
+	store := newMemStore()
+	creds := NewEncryptedCredentials(store, testKeyProvider("k1"))
+
+	cred := &helperCredential{Provisioner: "helper-test", Helper: "fake", Key: "server-1"}
+	if err := creds.Save("key-2", cred); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := creds.Get("key-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.(*helperCredential).Secret != "from-helper" {
+		t.Fatalf("expected helper-resolved secret, got %v", got.(*helperCredential).Secret)
+	}
+}
@@ -0,0 +1,141 @@
+package libmachete
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/libmachete/storage"
+)
+
+// ProfileEnvVar names the environment variable used to select the active
+// profile when a caller (e.g. a --profile flag) does not pass one explicitly.
+//
+// This module has no CLI entry points of its own (no flag/cobra usage
+// anywhere in this tree) to wire a --profile flag into. Any CLI built on top
+// of libmachete should pass its flag's value straight through to
+// Credentials.UseProfile / Profiles.SwitchProfile, which already fall back to
+// ProfileEnvVar when that value is "".
+const ProfileEnvVar = "MACHETE_PROFILE"
+
+// Profile is a named, layered bundle of settings for a single provisioner
+// call: which credential to load, which endpoint to hit, and any extra
+// metadata. Borrowed from Docker's context feature. A profile may declare
+// Inherits to override only specific fields of a shared base profile.
+type Profile struct {
+	Name          string            `json:"name"`
+	Provisioner   string            `json:"provisioner"`
+	CredentialKey string            `json:"credential_key"`
+	Endpoint      string            `json:"endpoint"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Inherits      string            `json:"inherits,omitempty"`
+}
+
+// Profiles manages named, layered credential profiles, so teams can keep a
+// shared base profile (e.g. "prod-aws") with per-user overrides of, say,
+// region or role ARN.
+type Profiles interface {
+	// CreateProfile saves a new profile under name.
+	CreateProfile(name string, profile Profile) error
+
+	// ListProfiles returns the names of every stored profile.
+	ListProfiles() ([]string, error)
+
+	// CurrentProfile returns the active profile name, taken from
+	// MACHETE_PROFILE, or "" if unset.
+	CurrentProfile() string
+
+	// SwitchProfile resolves name, following its inherits chain, and returns
+	// the fully-merged profile.
+	SwitchProfile(name string) (Profile, error)
+}
+
+type profiles struct {
+	store storage.Profiles
+}
+
+// NewProfiles creates a Profiles manager given the backing store.
+func NewProfiles(store storage.Profiles) Profiles {
+	return &profiles{store: store}
+}
+
+func (p *profiles) CreateProfile(name string, profile Profile) error {
+	profile.Name = name
+	return p.store.Save(storage.ProfileID(name), profile)
+}
+
+func (p *profiles) ListProfiles() ([]string, error) {
+	ids, err := p.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = string(id)
+	}
+	return names, nil
+}
+
+func (p *profiles) CurrentProfile() string {
+	return os.Getenv(ProfileEnvVar)
+}
+
+// SwitchProfile resolves name, falling back to CurrentProfile() (the
+// MACHETE_PROFILE env var) when name is empty -- the case when a --profile
+// flag was not passed on the command line.
+func (p *profiles) SwitchProfile(name string) (Profile, error) {
+	if name == "" {
+		name = p.CurrentProfile()
+	}
+	if name == "" {
+		return Profile{}, fmt.Errorf("no profile selected: pass --profile or set %v", ProfileEnvVar)
+	}
+	return p.resolve(name, map[string]bool{})
+}
+
+// resolve walks the inherits chain, overlaying each child's explicit fields
+// onto its base, and fails on a cycle instead of recursing forever.
+func (p *profiles) resolve(name string, seen map[string]bool) (Profile, error) {
+	if seen[name] {
+		return Profile{}, fmt.Errorf("cycle detected resolving profile %v", name)
+	}
+	seen[name] = true
+
+	profile := Profile{}
+	if err := p.store.GetProfile(storage.ProfileID(name), &profile); err != nil {
+		return Profile{}, err
+	}
+	if profile.Inherits == "" {
+		return profile, nil
+	}
+
+	base, err := p.resolve(profile.Inherits, seen)
+	if err != nil {
+		return Profile{}, err
+	}
+	return mergeProfile(base, profile), nil
+}
+
+// mergeProfile overlays child's explicitly-set fields onto base.
+func mergeProfile(base, child Profile) Profile {
+	merged := base
+	merged.Name = child.Name
+	merged.Inherits = child.Inherits
+
+	if child.Provisioner != "" {
+		merged.Provisioner = child.Provisioner
+	}
+	if child.CredentialKey != "" {
+		merged.CredentialKey = child.CredentialKey
+	}
+	if child.Endpoint != "" {
+		merged.Endpoint = child.Endpoint
+	}
+	for k, v := range child.Metadata {
+		if merged.Metadata == nil {
+			merged.Metadata = map[string]string{}
+		}
+		merged.Metadata[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,123 @@
+package libmachete
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/libmachete/storage"
+)
+
+type memProfileStore struct {
+	data map[storage.ProfileID]Profile
+}
+
+func newMemProfileStore() *memProfileStore {
+	return &memProfileStore{data: map[storage.ProfileID]Profile{}}
+}
+
+func (s *memProfileStore) List() ([]storage.ProfileID, error) {
+	ids := make([]storage.ProfileID, 0, len(s.data))
+	for id := range s.data {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *memProfileStore) Save(id storage.ProfileID, profile Profile) error {
+	s.data[id] = profile
+	return nil
+}
+
+func (s *memProfileStore) GetProfile(id storage.ProfileID, out *Profile) error {
+	profile, has := s.data[id]
+	if !has {
+		return os.ErrNotExist
+	}
+	*out = profile
+	return nil
+}
+
+func (s *memProfileStore) Delete(id storage.ProfileID) error {
+	delete(s.data, id)
+	return nil
+}
+
+func TestSwitchProfileMergesInheritedFields(t *testing.T) {
+	store := newMemProfileStore()
+	profiles := NewProfiles(store)
+
+	if err := profiles.CreateProfile("prod-aws", Profile{
+		Provisioner:   "aws",
+		CredentialKey: "prod-key",
+		Endpoint:      "https://ec2.us-east-1.amazonaws.com",
+		Metadata:      map[string]string{"region": "us-east-1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.CreateProfile("prod-aws-bob", Profile{
+		Inherits: "prod-aws",
+		Metadata: map[string]string{"region": "eu-west-1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := profiles.SwitchProfile("prod-aws-bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved.Provisioner != "aws" {
+		t.Errorf("expected inherited provisioner aws, got %v", resolved.Provisioner)
+	}
+	if resolved.CredentialKey != "prod-key" {
+		t.Errorf("expected inherited credential key, got %v", resolved.CredentialKey)
+	}
+	if resolved.Metadata["region"] != "eu-west-1" {
+		t.Errorf("expected overridden region eu-west-1, got %v", resolved.Metadata["region"])
+	}
+}
+
+func TestSwitchProfileDetectsCycle(t *testing.T) {
+	store := newMemProfileStore()
+	profiles := NewProfiles(store)
+
+	if err := profiles.CreateProfile("a", Profile{Inherits: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.CreateProfile("b", Profile{Inherits: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := profiles.SwitchProfile("a"); err == nil {
+		t.Fatal("expected a cycle detection error")
+	}
+}
+
+func TestSwitchProfileFallsBackToEnvVar(t *testing.T) {
+	store := newMemProfileStore()
+	profiles := NewProfiles(store)
+
+	if err := profiles.CreateProfile("default", Profile{Provisioner: "aws"}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(ProfileEnvVar, "default")
+	defer os.Unsetenv(ProfileEnvVar)
+
+	resolved, err := profiles.SwitchProfile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Provisioner != "aws" {
+		t.Errorf("expected profile picked up from %v, got %v", ProfileEnvVar, resolved.Provisioner)
+	}
+}
+
+func TestSwitchProfileErrorsWithNoNameOrEnvVar(t *testing.T) {
+	os.Unsetenv(ProfileEnvVar)
+
+	profiles := NewProfiles(newMemProfileStore())
+	if _, err := profiles.SwitchProfile(""); err == nil {
+		t.Fatal("expected an error when no profile name or env var is set")
+	}
+}
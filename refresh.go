@@ -0,0 +1,140 @@
+package libmachete
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+// RefreshableCredential is implemented by credentials backed by short-lived
+// identity tokens rather than long-lived passwords, modeled on Docker's shift
+// to identity tokens. NeedsRefresh/Refresh/ExpiresAt let the manager keep the
+// token current without requiring a restart.
+type RefreshableCredential interface {
+	api.Credential
+	NeedsRefresh() bool
+	Refresh(ctx context.Context) error
+	ExpiresAt() time.Time
+}
+
+// defaultRefreshPollInterval is how often a Refresher loop checks
+// NeedsRefresh when nothing more specific is configured.
+const defaultRefreshPollInterval = 30 * time.Second
+
+// Refresher runs a background goroutine per watched credential that polls
+// NeedsRefresh and, once it reports true, refreshes the credential, persists
+// the new token via Save, and publishes it to any Subscribe-ers so
+// provisioners pick up the hot-swapped credential without restart.
+type Refresher struct {
+	credentials  Credentials
+	pollInterval time.Duration
+
+	lock        sync.Mutex
+	subscribers map[string][]chan api.Credential
+	cancel      map[string]context.CancelFunc
+}
+
+// NewRefresher returns a Refresher that persists refreshed credentials
+// through credentials, polling NeedsRefresh every defaultRefreshPollInterval.
+func NewRefresher(credentials Credentials) *Refresher {
+	return NewRefresherWithPollInterval(credentials, defaultRefreshPollInterval)
+}
+
+// NewRefresherWithPollInterval is like NewRefresher, but lets callers tighten
+// (or loosen) how often NeedsRefresh is polled -- useful for credentials with
+// a short refresh lead time, or for tests.
+func NewRefresherWithPollInterval(credentials Credentials, pollInterval time.Duration) *Refresher {
+	return &Refresher{
+		credentials:  credentials,
+		pollInterval: pollInterval,
+		subscribers:  map[string][]chan api.Credential{},
+		cancel:       map[string]context.CancelFunc{},
+	}
+}
+
+// Watch starts a background refresh loop for key if cred is a
+// RefreshableCredential; it is a no-op otherwise. Calling Watch again for the
+// same key stops the previous loop first.
+func (r *Refresher) Watch(key string, cred api.Credential) {
+	refreshable, ok := cred.(RefreshableCredential)
+	if !ok {
+		return
+	}
+
+	r.Stop(key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.lock.Lock()
+	r.cancel[key] = cancel
+	r.lock.Unlock()
+
+	go r.loop(ctx, key, refreshable)
+}
+
+// Stop cancels the refresh loop for key, if one is running.
+func (r *Refresher) Stop(key string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if cancel, has := r.cancel[key]; has {
+		cancel()
+		delete(r.cancel, key)
+	}
+}
+
+// Subscribe returns a channel that receives cred when key is refreshed. The
+// channel buffers one update; a refresh published while that slot is still
+// full is dropped for this subscriber rather than blocking the refresh loop.
+func (r *Refresher) Subscribe(key string) <-chan api.Credential {
+	ch := make(chan api.Credential, 1)
+
+	r.lock.Lock()
+	r.subscribers[key] = append(r.subscribers[key], ch)
+	r.lock.Unlock()
+
+	return ch
+}
+
+// loop polls cred.NeedsRefresh() every pollInterval (checking once
+// immediately, so an already-due credential doesn't wait out a full poll
+// first) and only refreshes once it reports true. It deliberately does not
+// compute its wait from ExpiresAt: NeedsRefresh is the policy hook for
+// exactly this decision (e.g. OAuth2Credential wants a minute of lead time),
+// and sleeping to the literal expiry would hand out a credential that is
+// already at, or past, that boundary.
+func (r *Refresher) loop(ctx context.Context, key string, cred RefreshableCredential) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if cred.NeedsRefresh() {
+			if err := cred.Refresh(ctx); err != nil {
+				return
+			}
+			if err := r.credentials.Save(key, cred); err != nil {
+				return
+			}
+			r.publish(key, cred)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Refresher) publish(key string, cred api.Credential) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, ch := range r.subscribers[key] {
+		select {
+		case ch <- cred:
+		default:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package libmachete
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+// OAuth2Credential is a reference RefreshableCredential for provisioners that
+// authenticate with the OAuth2 client-credentials flow. AWS STS, GCP
+// service-account JWT exchange, or Vault AppRole logins can all be slotted in
+// by registering a Credentialer that returns one of these with Config set to
+// the provisioner-specific token endpoint.
+type OAuth2Credential struct {
+	api.CredentialBase
+
+	Config *clientcredentials.Config `json:"-"`
+
+	AccessToken string    `json:"access_token"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// NeedsRefresh returns true once the token is within a minute of expiring.
+func (c *OAuth2Credential) NeedsRefresh() bool {
+	return time.Now().Add(time.Minute).After(c.Expiry)
+}
+
+// ExpiresAt returns the token's expiry time.
+func (c *OAuth2Credential) ExpiresAt() time.Time {
+	return c.Expiry
+}
+
+// Refresh exchanges client credentials for a fresh access token.
+func (c *OAuth2Credential) Refresh(ctx context.Context) error {
+	token, err := c.Config.Token(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.AccessToken = token.AccessToken
+	c.Expiry = token.Expiry
+	return nil
+}
+
+var _ RefreshableCredential = (*OAuth2Credential)(nil)
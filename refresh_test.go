@@ -0,0 +1,135 @@
+package libmachete
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+type fakeRefreshable struct {
+	Provisioner string    `json:"provisioner"`
+	Refreshed   int32     `json:"refreshed"`
+	Expires     time.Time `json:"expires"`
+}
+
+func (c *fakeRefreshable) ProvisionerName() string { return c.Provisioner }
+func (c *fakeRefreshable) NeedsRefresh() bool       { return time.Now().After(c.Expires) }
+func (c *fakeRefreshable) ExpiresAt() time.Time     { return c.Expires }
+
+func (c *fakeRefreshable) Refresh(ctx context.Context) error {
+	atomic.AddInt32(&c.Refreshed, 1)
+	c.Expires = time.Now().Add(time.Hour)
+	return nil
+}
+
+func TestGetOpportunisticallyRefreshesExpiredCredential(t *testing.T) {
+	RegisterCredentialer("refreshable", func() api.Credential { return &fakeRefreshable{} })
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	cred := &fakeRefreshable{Provisioner: "refreshable", Expires: time.Now().Add(-time.Minute)}
+	if err := creds.Save("key-1", cred); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := creds.Get("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshed := got.(*fakeRefreshable)
+	if atomic.LoadInt32(&refreshed.Refreshed) != 1 {
+		t.Fatalf("expected Get to refresh an expired credential once, got %v refreshes", refreshed.Refreshed)
+	}
+
+	reloaded := new(fakeRefreshable)
+	if err := store.GetCredentials("key-1", reloaded); err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.Expires.After(time.Now()) {
+		t.Fatalf("expected the refreshed expiry to be persisted, got %v", reloaded.Expires)
+	}
+}
+
+func TestRefresherWatchPersistsAndPublishes(t *testing.T) {
+	RegisterCredentialer("refreshable", func() api.Credential { return &fakeRefreshable{} })
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	cred := &fakeRefreshable{Provisioner: "refreshable", Expires: time.Now().Add(10 * time.Millisecond)}
+	if err := creds.Save("key-2", cred); err != nil {
+		t.Fatal(err)
+	}
+
+	refresher := NewRefresherWithPollInterval(creds, 5*time.Millisecond)
+	updates := refresher.Subscribe("key-2")
+	refresher.Watch("key-2", cred)
+	defer refresher.Stop("key-2")
+
+	select {
+	case updated := <-updates:
+		if atomic.LoadInt32(&updated.(*fakeRefreshable).Refreshed) < 1 {
+			t.Fatal("expected at least one refresh to be published")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a refresh to be published")
+	}
+
+	saved := new(fakeRefreshable)
+	if err := store.GetCredentials("key-2", saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Expires.Before(time.Now()) {
+		t.Fatalf("expected the refreshed credential to be persisted, got %v", saved.Expires)
+	}
+}
+
+// leadTimeRefreshable models credentials like OAuth2Credential, whose
+// NeedsRefresh reports true some lead time before the literal ExpiresAt.
+type leadTimeRefreshable struct {
+	fakeRefreshable
+	lead time.Duration
+}
+
+func (c *leadTimeRefreshable) NeedsRefresh() bool {
+	return time.Now().Add(c.lead).After(c.Expires)
+}
+
+// TestRefresherRespectsNeedsRefreshLeadTime guards against Refresher.loop
+// sleeping to the literal ExpiresAt instead of polling NeedsRefresh: a
+// credential with a lead time must be refreshed before its original expiry,
+// not at or after it.
+func TestRefresherRespectsNeedsRefreshLeadTime(t *testing.T) {
+	RegisterCredentialer("refreshable-lead", func() api.Credential { return &fakeRefreshable{} })
+
+	store := newMemStore()
+	creds := NewCredentials(store)
+
+	originalExpiry := time.Now().Add(150 * time.Millisecond)
+	cred := &leadTimeRefreshable{
+		fakeRefreshable: fakeRefreshable{Provisioner: "refreshable-lead", Expires: originalExpiry},
+		lead:            100 * time.Millisecond,
+	}
+	if err := creds.Save("key-3", cred); err != nil {
+		t.Fatal(err)
+	}
+
+	refresher := NewRefresherWithPollInterval(creds, 5*time.Millisecond)
+	updates := refresher.Subscribe("key-3")
+	refresher.Watch("key-3", cred)
+	defer refresher.Stop("key-3")
+
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a refresh to be published")
+	}
+
+	if !time.Now().Before(originalExpiry) {
+		t.Fatalf("expected the refresh to complete before the original expiry %v (honoring NeedsRefresh's lead time), but it finished at %v", originalExpiry, time.Now())
+	}
+}
@@ -0,0 +1,187 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/docker/libmachete/provisioners/api"
+	"github.com/docker/libmachete/storage"
+)
+
+var (
+	credentialsBucket = []byte("credentials")
+	provisionerIndex  = []byte("by_provisioner")
+)
+
+// Store is a storage.Credentials backend on top of a local BoltDB file, so
+// infrakit can run without an external KV store. Alongside the primary bucket
+// keyed by storage.CredentialsID, it maintains a secondary index bucket keyed
+// by "<provisionerName>/<id>" so ListByProvisioner and GetAllMetadata can
+// stream matches without decoding every blob.
+type Store struct {
+	db *bbolt.DB
+}
+
+// NewStore opens (creating if necessary) the BoltDB file at path and returns
+// a storage.Credentials backed by it.
+func NewStore(path string) (*Store, error) {
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(credentialsBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(provisionerIndex)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close releases the underlying BoltDB file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func indexKey(provisionerName string, id storage.CredentialsID) []byte {
+	return []byte(fmt.Sprintf("%s/%s", provisionerName, id))
+}
+
+// List returns every credential id in the store.
+func (s *Store) List() ([]storage.CredentialsID, error) {
+	var ids []storage.CredentialsID
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(credentialsBucket).ForEach(func(k, v []byte) error {
+			ids = append(ids, storage.CredentialsID(k))
+			return nil
+		})
+	})
+	return ids, err
+}
+
+// Save persists cred under id, updating both the primary bucket and the
+// provisioner secondary index in a single transaction.
+func (s *Store) Save(id storage.CredentialsID, cred api.Credential) error {
+	blob, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if old := tx.Bucket(credentialsBucket).Get([]byte(id)); old != nil {
+			base := new(api.CredentialBase)
+			if err := json.Unmarshal(old, base); err != nil {
+				return err
+			}
+			if base.ProvisionerName() != cred.ProvisionerName() {
+				if err := tx.Bucket(provisionerIndex).Delete(indexKey(base.ProvisionerName(), id)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := tx.Bucket(credentialsBucket).Put([]byte(id), blob); err != nil {
+			return err
+		}
+		return tx.Bucket(provisionerIndex).Put(indexKey(cred.ProvisionerName(), id), []byte(id))
+	})
+}
+
+// GetCredentials decodes the blob stored under id into cred.
+func (s *Store) GetCredentials(id storage.CredentialsID, cred interface{}) error {
+	var blob []byte
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(credentialsBucket).Get([]byte(id))
+		if v == nil {
+			return fmt.Errorf("no credential found for %v", id)
+		}
+		blob = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, cred)
+}
+
+// Delete removes id from the primary bucket and its provisioner index entry.
+func (s *Store) Delete(id storage.CredentialsID) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(credentialsBucket).Get([]byte(id))
+		if v == nil {
+			return nil
+		}
+
+		base := new(api.CredentialBase)
+		if err := json.Unmarshal(v, base); err != nil {
+			return err
+		}
+
+		if err := tx.Bucket(provisionerIndex).Delete(indexKey(base.ProvisionerName(), id)); err != nil {
+			return err
+		}
+		return tx.Bucket(credentialsBucket).Delete([]byte(id))
+	})
+}
+
+// ListByProvisioner returns the ids of every credential belonging to
+// provisionerName, read off the secondary index without decoding blobs.
+func (s *Store) ListByProvisioner(provisionerName string) ([]string, error) {
+	prefix := []byte(provisionerName + "/")
+
+	var ids []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(provisionerIndex).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			ids = append(ids, string(v))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// GetAllMetadata streams the CredentialBase portion of every credential
+// belonging to provisionerName, without materializing full secrets. The
+// channels are closed once the scan completes or ctx is cancelled.
+func (s *Store) GetAllMetadata(ctx context.Context, provisionerName string) (<-chan api.CredentialBase, <-chan error) {
+	out := make(chan api.CredentialBase)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(out)
+		defer close(errs)
+
+		ids, err := s.ListByProvisioner(provisionerName)
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		for _, id := range ids {
+			base := new(api.CredentialBase)
+			if err := s.GetCredentials(storage.CredentialsID(id), base); err != nil {
+				errs <- err
+				return
+			}
+
+			select {
+			case out <- *base:
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return
+			}
+		}
+	}()
+
+	return out, errs
+}
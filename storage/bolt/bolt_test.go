@@ -0,0 +1,103 @@
+package bolt
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/docker/libmachete/storage"
+)
+
+type testCredential struct {
+	Provisioner string `json:"provisioner"`
+	Secret      string `json:"secret"`
+}
+
+func (c *testCredential) ProvisionerName() string { return c.Provisioner }
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "bolt-credentials-*.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	t.Cleanup(func() { os.Remove(f.Name()) })
+
+	store, err := NewStore(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestListByProvisionerScansIndexPrefix(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.Save("aws-1", &testCredential{Provisioner: "aws", Secret: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("aws-2", &testCredential{Provisioner: "aws", Secret: "a2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("gcp-1", &testCredential{Provisioner: "gcp", Secret: "g1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := store.ListByProvisioner("aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(ids)
+
+	if len(ids) != 2 || ids[0] != "aws-1" || ids[1] != "aws-2" {
+		t.Fatalf("expected [aws-1 aws-2], got %v", ids)
+	}
+}
+
+func TestDeleteRemovesIndexEntry(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.Save("aws-1", &testCredential{Provisioner: "aws"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete("aws-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := store.ListByProvisioner("aws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Fatalf("expected index entry to be removed, got %v", ids)
+	}
+}
+
+func TestGetAllMetadataStreamsWithoutSecrets(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.Save("aws-1", &testCredential{Provisioner: "aws", Secret: "s3cr3t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, errs := store.GetAllMetadata(context.Background(), "aws")
+
+	count := 0
+	for range out {
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Fatalf("expected 1 metadata record, got %v", count)
+	}
+}
+
+var _ storage.Credentials = (*Store)(nil)
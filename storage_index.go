@@ -0,0 +1,44 @@
+package libmachete
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/libmachete/provisioners/api"
+)
+
+// ProvisionerIndexedStore is implemented by storage.Credentials backends that
+// maintain a secondary index by provisioner name, such as storage/bolt.Store.
+// It lets the manager expose indexed lookups without depending on any one
+// backend's concrete type.
+type ProvisionerIndexedStore interface {
+	ListByProvisioner(provisionerName string) ([]string, error)
+	GetAllMetadata(ctx context.Context, provisionerName string) (<-chan api.CredentialBase, <-chan error)
+}
+
+// ListByProvisioner returns the ids of every credential belonging to
+// provisionerName. It requires a backing store that maintains a provisioner
+// index (e.g. storage/bolt.Store) and errors otherwise.
+func (cm *credentials) ListByProvisioner(provisionerName string) ([]string, error) {
+	indexed, ok := cm.store.(ProvisionerIndexedStore)
+	if !ok {
+		return nil, fmt.Errorf("backing store does not maintain a provisioner index")
+	}
+	return indexed.ListByProvisioner(provisionerName)
+}
+
+// GetAllMetadata streams the CredentialBase portion of every credential
+// belonging to provisionerName, without materializing full secrets. It
+// requires the same indexed backing store as ListByProvisioner.
+func (cm *credentials) GetAllMetadata(ctx context.Context, provisionerName string) (<-chan api.CredentialBase, <-chan error) {
+	indexed, ok := cm.store.(ProvisionerIndexedStore)
+	if !ok {
+		out := make(chan api.CredentialBase)
+		errs := make(chan error, 1)
+		close(out)
+		errs <- fmt.Errorf("backing store does not maintain a provisioner index")
+		close(errs)
+		return out, errs
+	}
+	return indexed.GetAllMetadata(ctx, provisionerName)
+}
@@ -0,0 +1,84 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+
+	"github.com/docker/libmachete/provisioners/api"
+	"github.com/docker/libmachete/storage"
+)
+
+// ClientStore implements storage.Credentials over a CredentialService. Pair it
+// with libmachete.NewCredentials to get a manager whose backing store lives on
+// a remote infrakit daemon instead of on local disk:
+//
+//	store, err := grpc.Dial("daemon:4321", grpc.WithInsecure())
+//	creds := libmachete.NewCredentials(store)
+type ClientStore struct {
+	rpc CredentialServiceClient
+}
+
+// Dial connects to addr and returns a storage.Credentials backed by it. It
+// always dials with the jsonCodec (see ServerCodec) so opts only needs to
+// cover transport concerns; pass grpc.WithTransportCredentials(credentials.NewTLS(...))
+// for mTLS. Pass a grpc.WithCodec of your own in opts to override the default.
+func Dial(addr string, opts ...grpc.DialOption) (storage.Credentials, error) {
+	dialOpts := append([]grpc.DialOption{grpc.WithCodec(jsonCodec{})}, opts...)
+	conn, err := grpc.Dial(addr, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientStore{rpc: NewCredentialServiceClient(conn)}, nil
+}
+
+func (c *ClientStore) List() ([]storage.CredentialsID, error) {
+	resp, err := c.rpc.List(context.Background(), &ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]storage.CredentialsID, len(resp.Keys))
+	for i, key := range resp.Keys {
+		ids[i] = storage.CredentialsID(key)
+	}
+	return ids, nil
+}
+
+// Save upserts cred over a single Update RPC: Server.Update falls back to
+// creating the record when it doesn't exist yet, so there is no separate
+// probe RPC to decide create-vs-update (which would race with a concurrent
+// caller) and no doubled round trip for the common update case.
+func (c *ClientStore) Save(id storage.CredentialsID, cred api.Credential) error {
+	payload, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	msg := &Credential{
+		Provisioner: cred.ProvisionerName(),
+		Key:         string(id),
+		ContentType: jsonContentType,
+		Payload:     payload,
+	}
+
+	_, err = c.rpc.Update(context.Background(), &UpdateRequest{Credential: msg})
+	return err
+}
+
+func (c *ClientStore) GetCredentials(id storage.CredentialsID, cred interface{}) error {
+	resp, err := c.rpc.Get(context.Background(), &GetRequest{Key: string(id)})
+	if err != nil {
+		return err
+	}
+	if ct := resp.Credential.ContentType; ct != jsonContentType {
+		return fmt.Errorf("transport/grpc: unsupported content type %q for key %v", ct, id)
+	}
+	return json.Unmarshal(resp.Credential.Payload, cred)
+}
+
+func (c *ClientStore) Delete(id storage.CredentialsID) error {
+	_, err := c.rpc.Delete(context.Background(), &DeleteRequest{Key: string(id)})
+	return err
+}
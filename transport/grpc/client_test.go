@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+type fakeCredential struct {
+	Provisioner string `json:"provisioner"`
+}
+
+func (f fakeCredential) ProvisionerName() string { return f.Provisioner }
+
+// fakeRPC records the requests it receives.
+type fakeRPC struct {
+	CredentialServiceClient
+	lastUpdate *UpdateRequest
+}
+
+func (f *fakeRPC) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	f.lastUpdate = in
+	return &UpdateResponse{}, nil
+}
+
+func TestClientStoreSaveSetsProvisionerAndContentType(t *testing.T) {
+	rpc := &fakeRPC{}
+	store := &ClientStore{rpc: rpc}
+
+	if err := store.Save("key-1", fakeCredential{Provisioner: "aws"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rpc.lastUpdate == nil {
+		t.Fatal("expected Save to upsert via a single Update call")
+	}
+	if rpc.lastUpdate.Credential.Provisioner != "aws" {
+		t.Errorf("expected provisioner %q, got %q", "aws", rpc.lastUpdate.Credential.Provisioner)
+	}
+	if rpc.lastUpdate.Credential.ContentType != jsonContentType {
+		t.Errorf("expected content type %q, got %q", jsonContentType, rpc.lastUpdate.Credential.ContentType)
+	}
+}
+
+func TestGetCredentialsRejectsUnknownContentType(t *testing.T) {
+	rpc := &fakeGetRPC{resp: &GetResponse{Credential: &Credential{ContentType: "application/x-protobuf", Payload: []byte("{}")}}}
+	store := &ClientStore{rpc: rpc}
+
+	if err := store.GetCredentials("key-1", &fakeCredential{}); err == nil {
+		t.Fatal("expected an error for an unrecognized content type, got nil")
+	}
+}
+
+type fakeGetRPC struct {
+	CredentialServiceClient
+	resp *GetResponse
+}
+
+func (f *fakeGetRPC) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	return f.resp, nil
+}
@@ -0,0 +1,32 @@
+package grpc
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+)
+
+// jsonContentType is the value ClientStore.Save stamps onto every Credential
+// it sends, and the only value GetCredentials will accept back: it records
+// what Payload actually is (JSON, via encoding/json) rather than leaving
+// ContentType unset and the format implicit.
+const jsonContentType = "application/json"
+
+// jsonCodec implements grpc.Codec with encoding/json. It exists because the
+// types in credentials.pb.go are plain structs, not protoc-gen-go messages,
+// so the default proto codec can't marshal them.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+func (jsonCodec) String() string { return "json" }
+
+// ServerCodec returns the grpc.ServerOption that makes a CredentialService
+// server speak the same codec Dial uses. Pass it to grpc.NewServer alongside
+// any TLS/interceptor options, then register a Server (see NewServer) on the
+// result with RegisterCredentialServiceServer.
+func ServerCodec() grpc.ServerOption {
+	return grpc.CustomCodec(jsonCodec{})
+}
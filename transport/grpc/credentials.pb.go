@@ -0,0 +1,232 @@
+// Package grpc's wire types mirror credentials.proto, but protoc was never
+// run against this tree (no protoc in the build), so these are hand-written
+// plain structs rather than protoc-gen-go output: they don't implement
+// proto.Message (no Reset/String/ProtoMessage/descriptor), so the default
+// grpc proto codec can't encode them. Dial and ServerCodec (codec.go) pair
+// grpc.Dial/grpc.NewServer with a Codec that actually can.
+package grpc
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+// Credential carries an opaque, codec-encoded payload so the existing
+// codec Marshal/Unmarshal path is reused unchanged on both ends.
+type Credential struct {
+	Provisioner string `protobuf:"bytes,1,opt,name=provisioner" json:"provisioner,omitempty"`
+	Key         string `protobuf:"bytes,2,opt,name=key" json:"key,omitempty"`
+	ContentType string `protobuf:"bytes,3,opt,name=content_type" json:"content_type,omitempty"`
+	Payload     []byte `protobuf:"bytes,4,opt,name=payload" json:"payload,omitempty"`
+}
+
+type CreateRequest struct {
+	Credential *Credential `protobuf:"bytes,1,opt,name=credential" json:"credential,omitempty"`
+}
+
+type CreateResponse struct{}
+
+type UpdateRequest struct {
+	Credential *Credential `protobuf:"bytes,1,opt,name=credential" json:"credential,omitempty"`
+}
+
+type UpdateResponse struct{}
+
+type GetRequest struct {
+	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+}
+
+type GetResponse struct {
+	Credential *Credential `protobuf:"bytes,1,opt,name=credential" json:"credential,omitempty"`
+}
+
+type DeleteRequest struct {
+	Key string `protobuf:"bytes,1,opt,name=key" json:"key,omitempty"`
+}
+
+type DeleteResponse struct{}
+
+type ListRequest struct{}
+
+type ListResponse struct {
+	Keys []string `protobuf:"bytes,1,rep,name=keys" json:"keys,omitempty"`
+}
+
+// CredentialServiceClient is the client API for CredentialService.
+type CredentialServiceClient interface {
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error)
+	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error)
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	StreamList(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (CredentialService_StreamListClient, error)
+}
+
+// CredentialService_StreamListClient is the client stream returned by StreamList.
+type CredentialService_StreamListClient interface {
+	Recv() (*ListResponse, error)
+	grpc.ClientStream
+}
+
+type credentialServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewCredentialServiceClient wraps a grpc.ClientConn dialed against a CredentialService server.
+func NewCredentialServiceClient(cc *grpc.ClientConn) CredentialServiceClient {
+	return &credentialServiceClient{cc}
+}
+
+func (c *credentialServiceClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*CreateResponse, error) {
+	out := new(CreateResponse)
+	err := grpc.Invoke(ctx, "/grpc.CredentialService/Create", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *credentialServiceClient) Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*UpdateResponse, error) {
+	out := new(UpdateResponse)
+	err := grpc.Invoke(ctx, "/grpc.CredentialService/Update", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *credentialServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := grpc.Invoke(ctx, "/grpc.CredentialService/Get", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *credentialServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := grpc.Invoke(ctx, "/grpc.CredentialService/Delete", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *credentialServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := grpc.Invoke(ctx, "/grpc.CredentialService/List", in, out, c.cc, opts...)
+	return out, err
+}
+
+func (c *credentialServiceClient) StreamList(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (CredentialService_StreamListClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_CredentialService_serviceDesc.Streams[0], c.cc, "/grpc.CredentialService/StreamList", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &credentialServiceStreamListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type credentialServiceStreamListClient struct {
+	grpc.ClientStream
+}
+
+func (x *credentialServiceStreamListClient) Recv() (*ListResponse, error) {
+	m := new(ListResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// CredentialServiceServer is the server API for CredentialService.
+type CredentialServiceServer interface {
+	Create(context.Context, *CreateRequest) (*CreateResponse, error)
+	Update(context.Context, *UpdateRequest) (*UpdateResponse, error)
+	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	StreamList(*ListRequest, CredentialService_StreamListServer) error
+}
+
+// CredentialService_StreamListServer is the server stream passed to StreamList.
+type CredentialService_StreamListServer interface {
+	Send(*ListResponse) error
+	grpc.ServerStream
+}
+
+type credentialServiceStreamListServer struct {
+	grpc.ServerStream
+}
+
+func (x *credentialServiceStreamListServer) Send(m *ListResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// RegisterCredentialServiceServer registers srv on s under the CredentialService name.
+func RegisterCredentialServiceServer(s *grpc.Server, srv CredentialServiceServer) {
+	s.RegisterService(&_CredentialService_serviceDesc, srv)
+}
+
+var _CredentialService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "grpc.CredentialService",
+	HandlerType: (*CredentialServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Create", Handler: _CredentialService_Create_Handler},
+		{MethodName: "Update", Handler: _CredentialService_Update_Handler},
+		{MethodName: "Get", Handler: _CredentialService_Get_Handler},
+		{MethodName: "Delete", Handler: _CredentialService_Delete_Handler},
+		{MethodName: "List", Handler: _CredentialService_List_Handler},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamList",
+			Handler:       _CredentialService_StreamList_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "credentials.proto",
+}
+
+func _CredentialService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(CredentialServiceServer).Create(ctx, in)
+}
+
+func _CredentialService_Update_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(CredentialServiceServer).Update(ctx, in)
+}
+
+func _CredentialService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(CredentialServiceServer).Get(ctx, in)
+}
+
+func _CredentialService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(CredentialServiceServer).Delete(ctx, in)
+}
+
+func _CredentialService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	return srv.(CredentialServiceServer).List(ctx, in)
+}
+
+func _CredentialService_StreamList_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CredentialServiceServer).StreamList(m, &credentialServiceStreamListServer{stream})
+}
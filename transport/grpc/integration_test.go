@@ -0,0 +1,113 @@
+package grpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/docker/libmachete"
+	"github.com/docker/libmachete/provisioners/api"
+	"github.com/docker/libmachete/storage"
+)
+
+// memCredStore is an in-memory storage.Credentials, standing in for a real
+// backend so the manager on the server side has somewhere to persist to.
+type memCredStore struct {
+	data map[storage.CredentialsID][]byte
+}
+
+func newMemCredStore() *memCredStore {
+	return &memCredStore{data: map[storage.CredentialsID][]byte{}}
+}
+
+func (s *memCredStore) List() ([]storage.CredentialsID, error) {
+	ids := make([]storage.CredentialsID, 0, len(s.data))
+	for id := range s.data {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *memCredStore) Save(id storage.CredentialsID, cred api.Credential) error {
+	blob, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	s.data[id] = blob
+	return nil
+}
+
+func (s *memCredStore) GetCredentials(id storage.CredentialsID, cred interface{}) error {
+	blob, has := s.data[id]
+	if !has {
+		return fmt.Errorf("not found: %v", id)
+	}
+	return json.Unmarshal(blob, cred)
+}
+
+func (s *memCredStore) Delete(id storage.CredentialsID) error {
+	delete(s.data, id)
+	return nil
+}
+
+type integrationCredential struct {
+	Provisioner string `json:"provisioner"`
+	Secret      string `json:"secret"`
+}
+
+func (c *integrationCredential) ProvisionerName() string { return c.Provisioner }
+
+// TestClientServerRoundTripOverBufconn dials a real grpc.Server/grpc.Dial pair
+// (over an in-memory bufconn listener, so the test doesn't need a free port)
+// using jsonCodec on both ends. It guards against credentials.pb.go's wire
+// types only working against the in-process fakeRPC stub: the default proto
+// codec would reject them outright, since they aren't proto.Message.
+func TestClientServerRoundTripOverBufconn(t *testing.T) {
+	libmachete.RegisterCredentialer("grpc-integration-test", func() api.Credential { return &integrationCredential{} })
+
+	lis := bufconn.Listen(1024 * 1024)
+	defer lis.Close()
+
+	manager := libmachete.NewCredentials(newMemCredStore())
+	srv := grpc.NewServer(ServerCodec())
+	RegisterCredentialServiceServer(srv, NewServer(manager))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	dialer := func(addr string, timeout time.Duration) (net.Conn, error) { return lis.Dial() }
+	store, err := Dial("bufconn", grpc.WithInsecure(), grpc.WithDialer(dialer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// First Save has no existing record: Server.Update must fall back to
+	// CreateCredential within the RPC, since ClientStore no longer probes
+	// with a separate Get.
+	if err := store.Save("key-1", &integrationCredential{Provisioner: "grpc-integration-test", Secret: "s3cr3t"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(integrationCredential)
+	if err := store.GetCredentials("key-1", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != "s3cr3t" {
+		t.Fatalf("expected s3cr3t, got %v", got.Secret)
+	}
+
+	// Second Save for the same key takes the plain update path.
+	if err := store.Save("key-1", &integrationCredential{Provisioner: "grpc-integration-test", Secret: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.GetCredentials("key-1", got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Secret != "updated" {
+		t.Fatalf("expected updated secret after the second Save, got %v", got.Secret)
+	}
+}
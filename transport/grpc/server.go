@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"bytes"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/libmachete"
+)
+
+// Server adapts a libmachete.Credentials manager to the CredentialService gRPC
+// API. Payloads are passed through to the manager's existing Create/Update/Get
+// calls unchanged, so the codec Marshal/Unmarshal path is reused as-is.
+type Server struct {
+	credentials libmachete.Credentials
+}
+
+// NewServer returns a CredentialServiceServer backed by credentials. Register
+// it with grpc.NewServer(grpc.Creds(credentials.NewTLS(...)), ...) for mTLS,
+// and pass grpc.UnaryInterceptor/grpc.StreamInterceptor for structured logging.
+func NewServer(credentials libmachete.Credentials) CredentialServiceServer {
+	return &Server{credentials: credentials}
+}
+
+func (s *Server) Create(ctx context.Context, req *CreateRequest) (*CreateResponse, error) {
+	cred := req.Credential
+	if err := s.credentials.CreateCredential(cred.Provisioner, cred.Key, bytes.NewReader(cred.Payload), nil); err != nil {
+		return nil, err
+	}
+	return &CreateResponse{}, nil
+}
+
+// Update upserts: it tries UpdateCredential first and, only if the record
+// doesn't exist yet, falls back to CreateCredential within this same RPC.
+// ClientStore.Save relies on that fallback instead of probing with a separate
+// Get, which would leave a TOCTOU race between the probe and the write.
+func (s *Server) Update(ctx context.Context, req *UpdateRequest) (*UpdateResponse, error) {
+	cred := req.Credential
+	if err := s.credentials.UpdateCredential(cred.Key, bytes.NewReader(cred.Payload), nil); err != nil {
+		if err.Code != libmachete.ErrCredentialNotFound {
+			return nil, err
+		}
+		if err := s.credentials.CreateCredential(cred.Provisioner, cred.Key, bytes.NewReader(cred.Payload), nil); err != nil {
+			return nil, err
+		}
+	}
+	return &UpdateResponse{}, nil
+}
+
+func (s *Server) Get(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+	cred, err := s.credentials.Get(req.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := s.credentials.Marshal(nil, cred)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetResponse{Credential: &Credential{Key: req.Key, ContentType: jsonContentType, Payload: payload}}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *DeleteRequest) (*DeleteResponse, error) {
+	if err := s.credentials.Delete(req.Key); err != nil {
+		return nil, err
+	}
+	return &DeleteResponse{}, nil
+}
+
+func (s *Server) List(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+	keys, err := s.credentials.ListIds()
+	if err != nil {
+		return nil, err
+	}
+	return &ListResponse{Keys: keys}, nil
+}
+
+func (s *Server) StreamList(req *ListRequest, stream CredentialService_StreamListServer) error {
+	resp, err := s.List(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.Send(resp)
+}